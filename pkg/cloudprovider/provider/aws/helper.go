@@ -1,17 +1,21 @@
 package aws
 
 import (
+	"context"
 	"fmt"
-	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/ec2"
-	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"github.com/golang/glog"
 	gocache "github.com/patrickmn/go-cache"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/kubermatic/machine-controller/pkg/providerconfig"
 
@@ -20,18 +24,21 @@ import (
 
 var (
 	volumeTypes = sets.NewString(
-		ec2.VolumeTypeStandard,
-		ec2.VolumeTypeIo1,
-		ec2.VolumeTypeGp2,
-		ec2.VolumeTypeSc1,
-		ec2.VolumeTypeSt1,
+		string(ec2types.VolumeTypeStandard),
+		string(ec2types.VolumeTypeIo1),
+		string(ec2types.VolumeTypeGp2),
+		string(ec2types.VolumeTypeSc1),
+		string(ec2types.VolumeTypeSt1),
 	)
 
+	// amiFilters holds the description/owner filters used by descriptionFilterAMIResolver. Keyed by
+	// OS only: osVersion is not taken into account, and an OS/osVersion pair missing from
+	// ssmAMIParameters does not fall back to these filters.
 	amiFilters = map[providerconfig.OperatingSystem]amiFilter{
 		providerconfig.OperatingSystemCoreos: {
-			description: "CoreOS Container Linux stable*",
-			// The AWS marketplace ID from CoreOS
-			owner: "595879546273",
+			description: "Flatcar Container Linux stable*",
+			// The AWS marketplace ID from Flatcar (successor to CoreOS, which is EOL)
+			owner: "075585003325",
 		},
 		providerconfig.OperatingSystemCentOS: {
 			description: "CentOS Linux 7 x86_64 HVM EBS*",
@@ -40,40 +47,74 @@ var (
 		},
 		providerconfig.OperatingSystemUbuntu: {
 			// Be as precise as possible - otherwise we might get a nightly dev build
-			description: "Canonical, Ubuntu, 18.04 LTS, amd64 bionic image build on ????-??-??",
+			description: "Canonical, Ubuntu, 22.04 LTS, amd64 jammy image build on ????-??-??",
 			// The AWS marketplace ID from Canonical
 			owner: "099720109477",
 		},
+		providerconfig.OperatingSystemRHEL: {
+			description: "Red Hat Enterprise Linux 8* x86_64*",
+			// The AWS marketplace ID from Red Hat
+			owner: "309956199498",
+		},
+		providerconfig.OperatingSystemAmazonLinux2: {
+			description: "Amazon Linux 2 AMI * x86_64 HVM gp2",
+			// The AWS marketplace ID for Amazon's own images
+			owner: "137112412989",
+		},
+	}
+
+	// ssmAMIParameters maps an OS/osVersion pair to the canonical AWS SSM public parameter that
+	// resolves to the current AMI ID for that combination. Used by ssmAMIResolver.
+	ssmAMIParameters = map[providerconfig.OperatingSystem]map[string]string{
+		providerconfig.OperatingSystemUbuntu: {
+			"20.04": "/aws/service/canonical/ubuntu/server/20.04/stable/current/amd64/hvm/ebs-gp2/ami-id",
+			"22.04": "/aws/service/canonical/ubuntu/server/22.04/stable/current/amd64/hvm/ebs-gp2/ami-id",
+		},
+		providerconfig.OperatingSystemAmazonLinux2: {
+			"": "/aws/service/ami-amazon-linux-latest/amzn2-ami-hvm-x86_64-gp2",
+		},
 	}
 
-	// cacheLock protects concurrent cache misses against a single key. This usually happens when multiple machines get created simultaneously
-	// We lock so the first access updates/writes the data to the cache and afterwards everyone reads the cached data
-	cacheLock = &sync.Mutex{}
-	cache     = gocache.New(5*time.Minute, 5*time.Minute)
+	// lookupGroup collapses concurrent cache misses for the same key into a single upstream call.
+	// This usually happens when multiple machines get created simultaneously: instead of every
+	// reconcile goroutine blocking behind a global lock to read the same cached VPC/AMI, cache hits
+	// stay lock-free and only the first concurrent miss for a given key actually calls AWS.
+	//
+	// Only getVpc/getDefaultAMIID exist in this package today; this package has no
+	// DescribeSecurityGroups/DescribeSubnets/DescribeInstanceProfile lookups (yet) to convert. Any
+	// future cached DescribeX call should key into this same lookupGroup/cache pair rather than
+	// introducing another mutex.
+	lookupGroup = &singleflight.Group{}
+	cache       = gocache.New(5*time.Minute, 5*time.Minute)
 )
 
-func getSession(id, secret, token, region string) (*session.Session, error) {
-	config := aws.NewConfig()
-	config = config.WithRegion(region)
-	config = config.WithCredentials(credentials.NewStaticCredentials(id, secret, token))
-	config = config.WithMaxRetries(maxRetries)
-	return session.NewSession(config)
+func getAWSConfig(ctx context.Context, id, secret, token, region string) (aws.Config, error) {
+	return config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(id, secret, token)),
+		config.WithRetryer(func() aws.Retryer {
+			return retry.NewAdaptiveMode()
+		}),
+	)
 }
 
-func getIAMclient(id, secret, region string) (*iam.IAM, error) {
-	sess, err := getSession(id, secret, "", region)
+func getIAMclient(ctx context.Context, id, secret, region string) (*iam.Client, error) {
+	cfg, err := getAWSConfig(ctx, id, secret, "", region)
 	if err != nil {
-		return nil, awsErrorToTerminalError(err, "failed to get aws session")
+		return nil, awsErrorToTerminalError(err, "failed to get aws config")
 	}
-	return iam.New(sess), nil
+	return iam.NewFromConfig(cfg), nil
 }
 
-func getEC2client(id, secret, region string) (*ec2.EC2, error) {
-	sess, err := getSession(id, secret, "", region)
+// getEC2client returns both the EC2 client and the aws.Config it was built from, so callers that
+// need a second client sharing the same credentials (e.g. SSM for AMI resolution) don't have to
+// rebuild and re-resolve credentials from scratch.
+func getEC2client(ctx context.Context, id, secret, region string) (*ec2.Client, aws.Config, error) {
+	cfg, err := getAWSConfig(ctx, id, secret, "", region)
 	if err != nil {
-		return nil, awsErrorToTerminalError(err, "failed to get aws session")
+		return nil, aws.Config{}, awsErrorToTerminalError(err, "failed to get aws config")
 	}
-	return ec2.New(sess), nil
+	return ec2.NewFromConfig(cfg), cfg, nil
 }
 
 func getDefaultRootDevicePath(os providerconfig.OperatingSystem) (string, error) {
@@ -89,32 +130,36 @@ func getDefaultRootDevicePath(os providerconfig.OperatingSystem) (string, error)
 	return "", fmt.Errorf("no default root path found for %s operating system", os)
 }
 
-func getVpc(client *ec2.EC2, id string) (*ec2.Vpc, error) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
-
-	cacheKey := fmt.Sprintf("vpc-%s-%s", *client.Config.Region, id)
+func getVpc(ctx context.Context, client *ec2.Client, id string) (*ec2types.Vpc, error) {
+	cacheKey := fmt.Sprintf("vpc-%s-%s", client.Options().Region, id)
 	if vpc, found := cache.Get(cacheKey); found {
-		glog.V(6).Infof("Found VPC %s in cache", *vpc.(*ec2.Vpc).VpcId)
-		return vpc.(*ec2.Vpc), nil
+		glog.V(6).Infof("Found VPC %s in cache", *vpc.(*ec2types.Vpc).VpcId)
+		return vpc.(*ec2types.Vpc), nil
 	}
 
-	vpcOut, err := client.DescribeVpcs(&ec2.DescribeVpcsInput{
-		Filters: []*ec2.Filter{
-			{Name: aws.String("vpc-id"), Values: []*string{aws.String(id)}},
-		},
-	})
+	v, err, _ := lookupGroup.Do(cacheKey, func() (interface{}, error) {
+		vpcOut, err := client.DescribeVpcs(ctx, &ec2.DescribeVpcsInput{
+			Filters: []ec2types.Filter{
+				{Name: aws.String("vpc-id"), Values: []string{id}},
+			},
+		})
+		if err != nil {
+			return nil, awsErrorToTerminalError(err, "failed to list vpc's")
+		}
 
-	if err != nil {
-		return nil, awsErrorToTerminalError(err, "failed to list vpc's")
-	}
+		if len(vpcOut.Vpcs) != 1 {
+			return nil, fmt.Errorf("unable to find specified vpc with id %q", id)
+		}
 
-	if len(vpcOut.Vpcs) != 1 {
-		return nil, fmt.Errorf("unable to find specified vpc with id %q", id)
+		vpc := &vpcOut.Vpcs[0]
+		cache.SetDefault(cacheKey, vpc)
+		return vpc, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	cache.SetDefault(cacheKey, vpcOut.Vpcs[0])
-	return vpcOut.Vpcs[0], nil
+	return v.(*ec2types.Vpc), nil
 }
 
 type amiFilter struct {
@@ -122,35 +167,58 @@ type amiFilter struct {
 	owner       string
 }
 
-func getDefaultAMIID(client *ec2.EC2, os providerconfig.OperatingSystem) (string, error) {
-	cacheLock.Lock()
-	defer cacheLock.Unlock()
+// ec2ImagesAPI is the subset of the EC2 client descriptionFilterAMIResolver needs, narrowed down
+// so tests can exercise it against a mock instead of a real EC2 client.
+type ec2ImagesAPI interface {
+	DescribeImages(ctx context.Context, in *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+}
+
+// ssmParameterAPI is the subset of the SSM client ssmAMIResolver needs, narrowed down so tests can
+// exercise it against a mock instead of a real SSM client.
+type ssmParameterAPI interface {
+	GetParameter(ctx context.Context, in *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// AMIResolver resolves the AMI ID to use for a given operating system/osVersion. Implementations
+// may hit the EC2 DescribeImages API, the SSM Parameter Store, or simply return a pinned value.
+type AMIResolver interface {
+	Resolve(ctx context.Context, client ec2ImagesAPI, os providerconfig.OperatingSystem, osVersion string) (string, error)
+}
 
+// staticAMIResolver always returns the configured AMI ID, whatever the OS/osVersion. A pinned
+// AMIID does not go through it: getDefaultAMIID returns the pin directly.
+type staticAMIResolver struct {
+	amiID string
+}
+
+func (r *staticAMIResolver) Resolve(_ context.Context, _ ec2ImagesAPI, _ providerconfig.OperatingSystem, _ string) (string, error) {
+	return r.amiID, nil
+}
+
+// descriptionFilterAMIResolver resolves the newest image matching the static description/owner
+// filters in amiFilters, the historical behaviour of this package
+type descriptionFilterAMIResolver struct{}
+
+func (r *descriptionFilterAMIResolver) Resolve(ctx context.Context, client ec2ImagesAPI, os providerconfig.OperatingSystem, _ string) (string, error) {
 	filter, osSupported := amiFilters[os]
 	if !osSupported {
 		return "", fmt.Errorf("operating system %q not supported", os)
 	}
 
-	cacheKey := fmt.Sprintf("ami-id-%s-%s", *client.Config.Region, os)
-	if amiID, found := cache.Get(cacheKey); found {
-		glog.V(6).Infof("Found AMI ID %s in cache", amiID.(string))
-		return amiID.(string), nil
-	}
-
-	imagesOut, err := client.DescribeImages(&ec2.DescribeImagesInput{
-		Owners: aws.StringSlice([]string{filter.owner}),
-		Filters: []*ec2.Filter{
+	imagesOut, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		Owners: []string{filter.owner},
+		Filters: []ec2types.Filter{
 			{
 				Name:   aws.String("description"),
-				Values: aws.StringSlice([]string{filter.description}),
+				Values: []string{filter.description},
 			},
 			{
 				Name:   aws.String("virtualization-type"),
-				Values: aws.StringSlice([]string{"hvm"}),
+				Values: []string{"hvm"},
 			},
 			{
 				Name:   aws.String("root-device-type"),
-				Values: aws.StringSlice([]string{"ebs"}),
+				Values: []string{"ebs"},
 			},
 		},
 	})
@@ -171,6 +239,79 @@ func getDefaultAMIID(client *ec2.EC2, os providerconfig.OperatingSystem) (string
 		}
 	}
 
-	cache.SetDefault(cacheKey, *image.ImageId)
 	return *image.ImageId, nil
 }
+
+// ssmAMIResolver resolves the AMI ID via the canonical AWS SSM public parameters, giving us
+// per-OS-version pinning without having to parse human-readable image descriptions. It is built
+// with an SSM client that was constructed from the same aws.Config (and therefore the same
+// credentials) as the EC2 client, instead of reloading the ambient default credential chain.
+type ssmAMIResolver struct {
+	client ssmParameterAPI
+}
+
+// newSSMAMIResolver builds an AMIResolver that resolves via SSM using ssmClient's credentials
+func newSSMAMIResolver(ssmClient ssmParameterAPI) AMIResolver {
+	return &ssmAMIResolver{client: ssmClient}
+}
+
+func (r *ssmAMIResolver) Resolve(ctx context.Context, _ ec2ImagesAPI, os providerconfig.OperatingSystem, osVersion string) (string, error) {
+	versions, osSupported := ssmAMIParameters[os]
+	if !osSupported {
+		return "", fmt.Errorf("operating system %q not supported by the ssm AMI resolver", os)
+	}
+
+	parameterName, versionSupported := versions[osVersion]
+	if !versionSupported {
+		return "", fmt.Errorf("os version %q of operating system %q not supported by the ssm AMI resolver", osVersion, os)
+	}
+
+	paramOut, err := r.client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(parameterName)})
+	if err != nil {
+		return "", awsErrorToTerminalError(err, fmt.Sprintf("failed to get ssm parameter %q", parameterName))
+	}
+
+	return *paramOut.Parameter.Value, nil
+}
+
+// getAMIResolver returns amiResolver if set, falling back to the description-filter resolver.
+// Callers that may have a pinned AMIID must short-circuit before reaching here - see getDefaultAMIID.
+func getAMIResolver(amiResolver AMIResolver) AMIResolver {
+	if amiResolver != nil {
+		return amiResolver
+	}
+	return &descriptionFilterAMIResolver{}
+}
+
+func getDefaultAMIID(ctx context.Context, client *ec2.Client, os providerconfig.OperatingSystem, osVersion, amiID string, resolver AMIResolver) (string, error) {
+	// A pinned AMIID is already a constant - return it directly instead of caching it under a key
+	// shared with every other lookup for the same region/os/osVersion, which would otherwise let
+	// one Machine's pinned AMI leak into another Machine's cache hit.
+	if amiID != "" {
+		return amiID, nil
+	}
+
+	// The resolver identity is part of the cache key: an SSM-resolved and a description-filter-resolved
+	// AMI for the same region/os/osVersion are not interchangeable and must not overwrite each other.
+	resolvedResolver := getAMIResolver(resolver)
+	cacheKey := fmt.Sprintf("ami-id-%s-%s-%s-%T", client.Options().Region, os, osVersion, resolvedResolver)
+	if cached, found := cache.Get(cacheKey); found {
+		glog.V(6).Infof("Found AMI ID %s in cache", cached.(string))
+		return cached.(string), nil
+	}
+
+	v, err, _ := lookupGroup.Do(cacheKey, func() (interface{}, error) {
+		resolvedAMIID, err := resolvedResolver.Resolve(ctx, client, os, osVersion)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.SetDefault(cacheKey, resolvedAMIID)
+		return resolvedAMIID, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
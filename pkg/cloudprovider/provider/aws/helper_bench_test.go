@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+)
+
+// BenchmarkGetVpcCacheHit exercises the concurrent cache-hit path that used to serialize on
+// cacheLock for every reconcile goroutine, even though they were all reading the same cached VPC.
+// With the singleflight-backed cache, a hit never blocks on anything but the underlying go-cache
+// map.
+func BenchmarkGetVpcCacheHit(b *testing.B) {
+	client := ec2.New(ec2.Options{Region: "eu-west-3"})
+	vpcID := "vpc-benchmark"
+	cacheKey := fmt.Sprintf("vpc-%s-%s", client.Options().Region, vpcID)
+	cache.SetDefault(cacheKey, &ec2types.Vpc{VpcId: aws.String(vpcID)})
+
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := getVpc(ctx, client, vpcID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGetDefaultAMIIDCacheHit is the AMI-ID equivalent of BenchmarkGetVpcCacheHit: the same
+// lock-free cache-hit path, exercised for the ami-id-<region>-<os>-<osVersion>-<resolver type> key.
+func BenchmarkGetDefaultAMIIDCacheHit(b *testing.B) {
+	client := ec2.New(ec2.Options{Region: "eu-west-3"})
+	os := providerconfig.OperatingSystemUbuntu
+	// getDefaultAMIID folds the resolver's concrete type into the cache key (see the comment above its cacheKey),
+	// so the benchmark's pre-populated entry must use the same default resolver it resolves to.
+	cacheKey := fmt.Sprintf("ami-id-%s-%s-%s-%T", client.Options().Region, os, "", getAMIResolver(nil))
+	cache.SetDefault(cacheKey, "ami-0123456789abcdef0")
+
+	ctx := context.Background()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := getDefaultAMIID(ctx, client, os, "", "", nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
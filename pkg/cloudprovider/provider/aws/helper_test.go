@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+)
+
+// mockEC2ImagesClient is a mocked ec2ImagesAPI that returns a canned DescribeImages response
+type mockEC2ImagesClient struct {
+	out *ec2.DescribeImagesOutput
+	err error
+}
+
+func (m *mockEC2ImagesClient) DescribeImages(_ context.Context, _ *ec2.DescribeImagesInput, _ ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return m.out, m.err
+}
+
+// mockSSMParameterClient is a mocked ssmParameterAPI that returns a canned GetParameter response
+type mockSSMParameterClient struct {
+	out *ssm.GetParameterOutput
+	err error
+}
+
+func (m *mockSSMParameterClient) GetParameter(_ context.Context, _ *ssm.GetParameterInput, _ ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	return m.out, m.err
+}
+
+func TestStaticAMIResolver(t *testing.T) {
+	resolver := &staticAMIResolver{amiID: "ami-static"}
+
+	got, err := resolver.Resolve(context.Background(), nil, providerconfig.OperatingSystemUbuntu, "22.04")
+	if err != nil {
+		t.Fatalf("Resolve returned an error: %v", err)
+	}
+	if got != "ami-static" {
+		t.Errorf("Resolve() = %q, want %q", got, "ami-static")
+	}
+}
+
+func TestDescriptionFilterAMIResolver(t *testing.T) {
+	client := &mockEC2ImagesClient{
+		out: &ec2.DescribeImagesOutput{
+			Images: []ec2types.Image{
+				{ImageId: aws.String("ami-old"), CreationDate: aws.String("2020-01-01T00:00:00.000Z")},
+				{ImageId: aws.String("ami-new"), CreationDate: aws.String("2023-01-01T00:00:00.000Z")},
+			},
+		},
+	}
+
+	resolver := &descriptionFilterAMIResolver{}
+	got, err := resolver.Resolve(context.Background(), client, providerconfig.OperatingSystemUbuntu, "")
+	if err != nil {
+		t.Fatalf("Resolve returned an error: %v", err)
+	}
+	if got != "ami-new" {
+		t.Errorf("Resolve() = %q, want the newest image %q", got, "ami-new")
+	}
+
+	if _, err := resolver.Resolve(context.Background(), client, providerconfig.OperatingSystem("solaris"), ""); err == nil {
+		t.Error("expected an error for an unsupported operating system, got nil")
+	}
+}
+
+func TestDescriptionFilterAMIResolverNoImages(t *testing.T) {
+	client := &mockEC2ImagesClient{out: &ec2.DescribeImagesOutput{}}
+
+	resolver := &descriptionFilterAMIResolver{}
+	if _, err := resolver.Resolve(context.Background(), client, providerconfig.OperatingSystemUbuntu, ""); err == nil {
+		t.Error("expected an error when no images are returned, got nil")
+	}
+}
+
+func TestSSMAMIResolver(t *testing.T) {
+	client := &mockSSMParameterClient{
+		out: &ssm.GetParameterOutput{
+			Parameter: &ssmtypes.Parameter{Value: aws.String("ami-from-ssm")},
+		},
+	}
+
+	resolver := newSSMAMIResolver(client)
+	got, err := resolver.Resolve(context.Background(), nil, providerconfig.OperatingSystemUbuntu, "22.04")
+	if err != nil {
+		t.Fatalf("Resolve returned an error: %v", err)
+	}
+	if got != "ami-from-ssm" {
+		t.Errorf("Resolve() = %q, want %q", got, "ami-from-ssm")
+	}
+
+	if _, err := resolver.Resolve(context.Background(), nil, providerconfig.OperatingSystemUbuntu, "99.04"); err == nil {
+		t.Error("expected an error for an unsupported os version, got nil")
+	}
+
+	if _, err := resolver.Resolve(context.Background(), nil, providerconfig.OperatingSystemCentOS, ""); err == nil {
+		t.Error("expected an error for an unsupported operating system, got nil")
+	}
+}
+
+func TestGetAMIResolver(t *testing.T) {
+	ssmResolver := newSSMAMIResolver(&mockSSMParameterClient{})
+	if got := getAMIResolver(ssmResolver); got != ssmResolver {
+		t.Error("expected an explicit resolver to be returned unchanged")
+	}
+
+	if _, ok := getAMIResolver(nil).(*descriptionFilterAMIResolver); !ok {
+		t.Error("expected the default resolver to be the descriptionFilterAMIResolver")
+	}
+}
+
+func TestGetDefaultAMIIDPinnedDoesNotShareCache(t *testing.T) {
+	client := ec2.New(ec2.Options{Region: "eu-west-3"})
+	ctx := context.Background()
+
+	gotA, err := getDefaultAMIID(ctx, client, providerconfig.OperatingSystemUbuntu, "", "ami-AAA", nil)
+	if err != nil {
+		t.Fatalf("getDefaultAMIID returned an error: %v", err)
+	}
+	if gotA != "ami-AAA" {
+		t.Fatalf("getDefaultAMIID() = %q, want %q", gotA, "ami-AAA")
+	}
+
+	gotB, err := getDefaultAMIID(ctx, client, providerconfig.OperatingSystemUbuntu, "", "ami-BBB", nil)
+	if err != nil {
+		t.Fatalf("getDefaultAMIID returned an error: %v", err)
+	}
+	if gotB != "ami-BBB" {
+		t.Fatalf("getDefaultAMIID() = %q, want %q, pinned AMIs must not be served from another Machine's cache entry", gotB, "ami-BBB")
+	}
+}
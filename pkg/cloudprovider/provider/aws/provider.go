@@ -0,0 +1,77 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"github.com/kubermatic/machine-controller/pkg/providerconfig"
+	"github.com/kubermatic/machine-controller/pkg/userdata/helper"
+)
+
+// AMIResolverKind selects which AMIResolver implementation resolveAMI should use when the user
+// has not pinned an explicit AMIID.
+type AMIResolverKind string
+
+const (
+	// AMIResolverDescriptionFilter resolves the newest image matching amiFilters (the historical behaviour)
+	AMIResolverDescriptionFilter AMIResolverKind = "description-filter"
+	// AMIResolverSSM resolves via the canonical AWS SSM public parameters, giving per-OS-version pinning
+	AMIResolverSSM AMIResolverKind = "ssm"
+)
+
+// RawConfig is the AWS-specific portion of a MachineDeployment's providerSpec. Only the fields
+// touched by the container-runtime and AMI-resolver work are reproduced here.
+type RawConfig struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	Region          string
+
+	// AMIID pins an explicit AMI, bypassing AMIResolver entirely
+	AMIID string
+	// OSVersion selects the OS release the AMIResolver should resolve, e.g. "22.04" for Ubuntu
+	OSVersion string
+	// AMIResolver picks the resolution strategy used when AMIID is empty; defaults to AMIResolverDescriptionFilter
+	AMIResolver AMIResolverKind
+
+	// ContainerRuntime selects the container runtime the node is bootstrapped with; defaults to Docker
+	ContainerRuntime helper.ContainerRuntime
+	// ContainerRuntimeSandboxImage is the pause/sandbox image used by containerd and CRI-O; ignored for Docker
+	ContainerRuntimeSandboxImage string
+}
+
+// resolveAMI resolves the AMI to launch the instance from, honouring an explicit AMIID pin before
+// falling back to the resolver selected by RawConfig.AMIResolver. The SSM resolver is built from
+// the same aws.Config (and therefore the same credentials) used for the EC2 client.
+func resolveAMI(ctx context.Context, client *ec2.Client, cfg aws.Config, os providerconfig.OperatingSystem, rawConfig *RawConfig) (string, error) {
+	var resolver AMIResolver
+	switch rawConfig.AMIResolver {
+	case "", AMIResolverDescriptionFilter:
+		resolver = &descriptionFilterAMIResolver{}
+	case AMIResolverSSM:
+		resolver = newSSMAMIResolver(ssm.NewFromConfig(cfg))
+	default:
+		return "", fmt.Errorf("unknown ami resolver %q", rawConfig.AMIResolver)
+	}
+
+	return getDefaultAMIID(ctx, client, os, rawConfig.OSVersion, rawConfig.AMIID, resolver)
+}
+
+// containerRuntimeUserdata returns the engine config, systemd unit, and extra kubelet flags for
+// the RawConfig's configured container runtime, ready to be dropped into the cloud-init template.
+func containerRuntimeUserdata(cfg *RawConfig, setTasksMax bool) (config, systemdUnit string, kubeletFlags []string, err error) {
+	config, systemdUnit, err = helper.ContainerRuntimeConfigAndUnit(cfg.ContainerRuntime, setTasksMax, cfg.ContainerRuntimeSandboxImage)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	kubeletFlags, err = helper.KubeletContainerRuntimeFlags(cfg.ContainerRuntime)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return config, systemdUnit, kubeletFlags, nil
+}
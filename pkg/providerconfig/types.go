@@ -0,0 +1,12 @@
+package providerconfig
+
+// OperatingSystem identifies the OS a Machine should be provisioned with
+type OperatingSystem string
+
+const (
+	OperatingSystemCoreos       OperatingSystem = "coreos"
+	OperatingSystemCentOS       OperatingSystem = "centos"
+	OperatingSystemUbuntu       OperatingSystem = "ubuntu"
+	OperatingSystemRHEL         OperatingSystem = "rhel"
+	OperatingSystemAmazonLinux2 OperatingSystem = "amzn2"
+)
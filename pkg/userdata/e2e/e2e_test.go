@@ -0,0 +1,190 @@
+// Package e2e boots the userdata generated by pkg/userdata/helper on real cloud images under qemu
+// and verifies the resulting node actually comes up, something string-level unit tests of the
+// generated systemd units/daemon configs can never catch (a bad TasksMax value, a missing
+// Requires=docker.socket, ...).
+//
+// These tests are slow and require qemu-system-x86_64 plus network access to fetch cloud images,
+// so they are gated behind -run-vm-tests and skipped by default.
+package e2e
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/semaphore"
+)
+
+var (
+	runVMTests = flag.Bool("run-vm-tests", false, "run the VM-based cloud-init end-to-end tests (requires qemu-system-x86_64)")
+	ramLimitMB = flag.Int64("ram-limit", 4096, "total megabytes of RAM the VM matrix may use concurrently")
+)
+
+// distro describes a cloud image to boot and verify
+type distro struct {
+	name        string
+	imageURL    string
+	cachePrefix string
+	vmRAMMB     int64
+}
+
+var distros = []distro{
+	{name: "ubuntu-22.04", imageURL: "https://cloud-images.ubuntu.com/jammy/current/jammy-server-cloudimg-amd64.img", cachePrefix: "cloud-init-e2e/ubuntu-22.04", vmRAMMB: 1024},
+	{name: "centos-7", imageURL: "https://cloud.centos.org/centos/7/images/CentOS-7-x86_64-GenericCloud.qcow2", cachePrefix: "cloud-init-e2e/centos-7", vmRAMMB: 1024},
+	{name: "flatcar-stable", imageURL: "https://stable.release.flatcar-linux.net/amd64-usr/current/flatcar_production_qemu_image.img", cachePrefix: "cloud-init-e2e/flatcar-stable", vmRAMMB: 1024},
+}
+
+// cacheBucket is the S3 bucket that mirrors the upstream cloud images so CI does not hammer
+// distro infra on every run. Empty disables the mirror and falls back to imageURL directly.
+const cacheBucket = ""
+
+func TestCloudInitBootsDistros(t *testing.T) {
+	if !*runVMTests {
+		t.Skip("skipping VM-based test, pass -run-vm-tests to enable")
+	}
+
+	sem := semaphore.NewWeighted(*ramLimitMB)
+	ctx := context.Background()
+
+	for _, d := range distros {
+		d := d
+		t.Run(d.name, func(t *testing.T) {
+			t.Parallel()
+
+			if err := sem.Acquire(ctx, d.vmRAMMB); err != nil {
+				t.Fatalf("failed to acquire %dMB from the ram-limit semaphore: %v", d.vmRAMMB, err)
+			}
+			defer sem.Release(d.vmRAMMB)
+
+			image, err := fetchImage(ctx, d)
+			if err != nil {
+				t.Fatalf("failed to fetch cloud image for %s: %v", d.name, err)
+			}
+
+			signer, authorizedKey, err := newSSHKeyPair()
+			if err != nil {
+				t.Fatalf("failed to generate ssh key pair for %s: %v", d.name, err)
+			}
+
+			userData, err := buildUserData(authorizedKey)
+			if err != nil {
+				t.Fatalf("failed to build userdata for %s: %v", d.name, err)
+			}
+
+			vm, err := bootVM(ctx, d, image, userData)
+			if err != nil {
+				t.Fatalf("failed to boot VM for %s: %v", d.name, err)
+			}
+			defer vm.shutdown()
+
+			client, err := vm.dialSSH(2*time.Minute, sshUser, signer)
+			if err != nil {
+				t.Fatalf("failed to ssh into %s: %v", d.name, err)
+			}
+			defer client.Close()
+
+			// kubelet is not part of what buildUserData provisions - pkg/userdata/helper's
+			// container-runtime templates only cover the engine itself - so it is not asserted here.
+			for _, cmd := range []string{"docker info", "systemctl is-active docker"} {
+				if out, err := runSSH(client, cmd); err != nil {
+					t.Errorf("%q failed on %s: %v\noutput:\n%s", cmd, d.name, err, out)
+				}
+			}
+		})
+	}
+}
+
+// fetchImage downloads the cloud image for d into the local cache, preferring the S3 mirror in
+// cacheBucket and falling back to the upstream distro mirror in imageURL.
+func fetchImage(ctx context.Context, d distro) (string, error) {
+	cacheDir := filepath.Join(os.TempDir(), "machine-controller-e2e-cache")
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	dest := filepath.Join(cacheDir, d.name+".img")
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+
+	url := d.imageURL
+	if cacheBucket != "" {
+		url = fmt.Sprintf("https://%s.s3.amazonaws.com/%s", cacheBucket, d.cachePrefix)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if cacheBucket != "" {
+			return fetchImageFrom(ctx, d.imageURL, dest)
+		}
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		if cacheBucket != "" {
+			return fetchImageFrom(ctx, d.imageURL, dest)
+		}
+		return "", fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", err
+	}
+
+	return dest, nil
+}
+
+func fetchImageFrom(ctx context.Context, url, dest string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return dest, err
+}
+
+// runSSH executes cmd on the remote session and returns its combined output
+func runSSH(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	return string(out), err
+}
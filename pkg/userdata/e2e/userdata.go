@@ -0,0 +1,93 @@
+package e2e
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/kubermatic/machine-controller/pkg/userdata/helper"
+)
+
+// sshUser is the account cloud-init provisions for the test harness to log in as
+const sshUser = "machine-controller-e2e"
+
+// newSSHKeyPair generates an ephemeral ed25519 key pair for a single test run and returns a signer
+// for dialling the VM plus the OpenSSH authorized_keys line to hand to cloud-init
+func newSSHKeyPair() (ssh.Signer, string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate ssh key pair: %w", err)
+	}
+
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build ssh signer: %w", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build ssh public key: %w", err)
+	}
+
+	return signer, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))), nil
+}
+
+// dockerStaticBinariesURL points at the upstream static Docker Engine release that provides the
+// /opt/bin/dockerd binary the generated systemd unit's ExecStart expects, plus the containerd/runc
+// binaries dockerd runs - the cloud images this harness boots don't ship them, only real
+// Machines' full provisioning scripts do.
+const dockerStaticBinariesURL = "https://download.docker.com/linux/static/stable/x86_64/docker-24.0.7.tgz"
+
+// buildUserData renders the cloud-config served to the VM: an SSH-capable user, the real Docker
+// daemon.json/systemd service and socket units generated by pkg/userdata/helper (the same content
+// real Machines get), and a runcmd step unpacking the static Docker release into /opt/bin, where
+// those files expect it, with docker linked into /usr/local/bin for the ssh session's PATH. That's
+// what lets the VM's docker info/systemctl is-active docker actually exercise the generated config
+// instead of a stub. kubelet provisioning is out of scope for pkg/userdata/helper's container
+// runtime templates, so it is not asserted here.
+func buildUserData(authorizedKey string) (string, error) {
+	daemonConfig := helper.DockerDaemonConfig()
+
+	dockerUnit, err := helper.DockerSystemdUnit(true)
+	if err != nil {
+		return "", fmt.Errorf("failed to render docker systemd unit: %w", err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#cloud-config\n")
+	fmt.Fprintf(&b, "users:\n")
+	fmt.Fprintf(&b, "  - name: %s\n", sshUser)
+	fmt.Fprintf(&b, "    groups: [sudo, docker]\n")
+	fmt.Fprintf(&b, "    shell: /bin/bash\n")
+	fmt.Fprintf(&b, "    sudo: ['ALL=(ALL) NOPASSWD:ALL']\n")
+	fmt.Fprintf(&b, "    ssh_authorized_keys:\n")
+	fmt.Fprintf(&b, "      - %s\n", authorizedKey)
+	fmt.Fprintf(&b, "write_files:\n")
+	fmt.Fprintf(&b, "  - path: /etc/docker/daemon.json\n")
+	fmt.Fprintf(&b, "    content: |\n%s\n", indentBlock(daemonConfig, 6))
+	fmt.Fprintf(&b, "  - path: /etc/systemd/system/docker.service\n")
+	fmt.Fprintf(&b, "    content: |\n%s\n", indentBlock(dockerUnit, 6))
+	fmt.Fprintf(&b, "  - path: /etc/systemd/system/docker.socket\n")
+	fmt.Fprintf(&b, "    content: |\n%s\n", indentBlock(helper.DockerSystemdSocket(), 6))
+	fmt.Fprintf(&b, "runcmd:\n")
+	fmt.Fprintf(&b, "  - mkdir -p /opt/bin\n")
+	fmt.Fprintf(&b, "  - curl -fsSL %s | tar -xz -C /opt/bin --strip-components=1\n", dockerStaticBinariesURL)
+	fmt.Fprintf(&b, "  - ln -sf /opt/bin/docker /usr/local/bin/docker\n")
+	fmt.Fprintf(&b, "  - systemctl daemon-reload\n")
+	fmt.Fprintf(&b, "  - systemctl enable --now docker\n")
+
+	return b.String(), nil
+}
+
+// indentBlock prefixes every line of s with n spaces, as required for a YAML block scalar
+func indentBlock(s string, n int) string {
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = prefix + line
+	}
+	return strings.Join(lines, "\n")
+}
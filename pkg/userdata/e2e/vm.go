@@ -0,0 +1,113 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// vm represents a qemu instance booted with the generated userdata served as its cloud-init
+// NoCloud HTTP (nocloud-net) datasource.
+type vm struct {
+	cmd        *exec.Cmd
+	datasource *http.Server
+	sshAddr    string
+}
+
+// bootVM starts qemu for the given distro/image, serving userData via a local HTTP datasource and
+// forwarding a host port to the guest's SSH daemon. userData is the actual cloud-config produced by
+// buildUserData, i.e. the same systemd units/daemon config pkg/userdata/helper emits for real
+// Machines - that's what lets this harness catch a bad TasksMax or a missing Requires=docker.socket.
+func bootVM(ctx context.Context, d distro, imagePath, userData string) (*vm, error) {
+	sshPort, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a free port for ssh forwarding: %w", err)
+	}
+
+	datasourcePort, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find a free port for the cloud-init datasource: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/meta-data", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "instance-id: %s\nlocal-hostname: %s\n", d.name, d.name)
+	})
+	mux.HandleFunc("/user-data", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, userData)
+	})
+	datasource := &http.Server{Addr: fmt.Sprintf("127.0.0.1:%d", datasourcePort), Handler: mux}
+	go func() {
+		_ = datasource.ListenAndServe()
+	}()
+
+	// The datasource server binds the host's own loopback, but the guest reaches the host through
+	// qemu's user-mode (slirp) network at 10.0.2.2, not 127.0.0.1 - that address is the guest's own
+	// loopback.
+	cmd := exec.CommandContext(ctx, "qemu-system-x86_64",
+		"-m", fmt.Sprintf("%d", d.vmRAMMB),
+		"-nographic",
+		"-drive", fmt.Sprintf("file=%s,if=virtio", imagePath),
+		"-smbios", fmt.Sprintf("type=1,serial=ds=nocloud-net;s=http://10.0.2.2:%d/", datasourcePort),
+		"-netdev", fmt.Sprintf("user,id=net0,hostfwd=tcp::%d-:22", sshPort),
+		"-device", "virtio-net-pci,netdev=net0",
+	)
+
+	if err := cmd.Start(); err != nil {
+		_ = datasource.Close()
+		return nil, fmt.Errorf("failed to start qemu: %w", err)
+	}
+
+	return &vm{
+		cmd:        cmd,
+		datasource: datasource,
+		sshAddr:    fmt.Sprintf("127.0.0.1:%d", sshPort),
+	}, nil
+}
+
+// dialSSH retries dialling the forwarded SSH port, authenticating as user with signer, until it
+// succeeds or timeout elapses. user/signer must match the key-based login the userdata passed to
+// bootVM provisioned via cloud-init's users/ssh_authorized_keys.
+func (v *vm) dialSSH(timeout time.Duration, user string, signer ssh.Signer) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            user,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		client, err := ssh.Dial("tcp", v.sshAddr, config)
+		if err == nil {
+			return client, nil
+		}
+		lastErr = err
+		time.Sleep(2 * time.Second)
+	}
+
+	return nil, fmt.Errorf("timed out dialling %s: %w", v.sshAddr, lastErr)
+}
+
+func (v *vm) shutdown() {
+	_ = v.datasource.Close()
+	if v.cmd.Process != nil {
+		_ = v.cmd.Process.Kill()
+	}
+	_ = v.cmd.Wait()
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -6,6 +6,39 @@ import (
 	"text/template"
 )
 
+// ContainerRuntime identifies the container runtime a Machine should be bootstrapped with
+type ContainerRuntime string
+
+const (
+	// ContainerRuntimeDocker uses dockerd, shimmed through dockershim
+	ContainerRuntimeDocker ContainerRuntime = "docker"
+	// ContainerRuntimeContainerd uses containerd directly via the CRI plugin
+	ContainerRuntimeContainerd ContainerRuntime = "containerd"
+	// ContainerRuntimeCRIO uses CRI-O
+	ContainerRuntimeCRIO ContainerRuntime = "crio"
+)
+
+// KubeletContainerRuntimeFlags returns the kubelet flags required to make it talk to the given
+// container runtime's CRI socket. Docker needs no extra flags as it is the kubelet's built-in default.
+func KubeletContainerRuntimeFlags(cr ContainerRuntime) ([]string, error) {
+	switch cr {
+	case ContainerRuntimeDocker, "":
+		return nil, nil
+	case ContainerRuntimeContainerd:
+		return []string{
+			"--container-runtime=remote",
+			"--container-runtime-endpoint=unix:///run/containerd/containerd.sock",
+		}, nil
+	case ContainerRuntimeCRIO:
+		return []string{
+			"--container-runtime=remote",
+			"--container-runtime-endpoint=unix:///var/run/crio/crio.sock",
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown container runtime %q", cr)
+}
+
 // DockerDaemonConfig returns the docker daemon.json with preferred settings
 func DockerDaemonConfig() string {
 	return `{
@@ -92,3 +125,188 @@ SocketGroup=docker
 [Install]
 WantedBy=sockets.target`
 }
+
+const containerdConfigTpl = `version = 2
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "{{ .SandboxImage }}"
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes]
+        [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc]
+          runtime_type = "io.containerd.runc.v2"
+          [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+            SystemdCgroup = true`
+
+// ContainerdConfig returns the containerd config.toml with the systemd cgroup driver enabled and the given sandbox (pause) image
+func ContainerdConfig(sandboxImage string) (string, error) {
+	tmpl, err := template.New("containerd-config").Funcs(TxtFuncMap()).Parse(containerdConfigTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse containerd-config template: %v", err)
+	}
+
+	data := struct {
+		SandboxImage string
+	}{
+		SandboxImage: sandboxImage,
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute containerd-config template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
+const containerdSystemdUnitTpl = `[Unit]
+Description=containerd container runtime
+Documentation=https://containerd.io
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Environment="PATH=/opt/bin:/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin/"
+ExecStartPre=-/sbin/modprobe overlay
+ExecStart=/opt/bin/containerd
+Type=notify
+Delegate=yes
+KillMode=process
+Restart=always
+RestartSec=5
+# Having non-zero Limit*s causes performance problems due to accounting overhead
+# in the kernel. We recommend using cgroups to do container-local accounting.
+LimitNPROC=infinity
+LimitCORE=infinity
+LimitNOFILE=infinity
+TasksMax=infinity
+OOMScoreAdjust=-999
+
+[Install]
+WantedBy=multi-user.target`
+
+// ContainerdSystemdUnit returns the systemd unit for containerd
+func ContainerdSystemdUnit() (string, error) {
+	tmpl, err := template.New("containerd-systemd-unit").Funcs(TxtFuncMap()).Parse(containerdSystemdUnitTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse containerd-systemd-unit template: %v", err)
+	}
+
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute containerd-systemd-unit template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
+const crioConfigTpl = `[crio]
+[crio.runtime]
+cgroup_manager = "systemd"
+conmon = "/usr/libexec/crio/conmon"
+conmon_cgroup = "system.slice"
+
+[crio.image]
+pause_image = "{{ .SandboxImage }}"
+
+[crio.network]
+network_dir = "/etc/cni/net.d/"
+plugin_dirs = [
+	"/opt/cni/bin/",
+]`
+
+// CRIOConfig returns the crio.conf with the systemd cgroup driver enabled and the given sandbox (pause) image
+func CRIOConfig(sandboxImage string) (string, error) {
+	tmpl, err := template.New("crio-config").Funcs(TxtFuncMap()).Parse(crioConfigTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse crio-config template: %v", err)
+	}
+
+	data := struct {
+		SandboxImage string
+	}{
+		SandboxImage: sandboxImage,
+	}
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute crio-config template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
+const crioSystemdUnitTpl = `[Unit]
+Description=Container Runtime Interface for OCI (CRI-O)
+Documentation=https://github.com/cri-o/cri-o
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Environment="PATH=/opt/bin:/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin/"
+Type=notify
+ExecStart=/opt/bin/crio
+Restart=on-failure
+RestartSec=5
+LimitNOFILE=1048576
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+Delegate=yes
+KillMode=process
+
+[Install]
+WantedBy=multi-user.target`
+
+// CRIOSystemdUnit returns the systemd unit for CRI-O
+func CRIOSystemdUnit() (string, error) {
+	tmpl, err := template.New("crio-systemd-unit").Funcs(TxtFuncMap()).Parse(crioSystemdUnitTpl)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse crio-systemd-unit template: %v", err)
+	}
+
+	b := &bytes.Buffer{}
+	err = tmpl.Execute(b, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to execute crio-systemd-unit template: %v", err)
+	}
+
+	return b.String(), nil
+}
+
+// ContainerRuntimeConfigAndUnit returns the engine config file and systemd unit for the given
+// container runtime, so the cloud-init template can write_files/enable them without having to
+// know which runtime it is dealing with. sandboxImage is ignored for docker.
+func ContainerRuntimeConfigAndUnit(cr ContainerRuntime, setTasksMax bool, sandboxImage string) (config, systemdUnit string, err error) {
+	switch cr {
+	case ContainerRuntimeDocker, "":
+		unit, err := DockerSystemdUnit(setTasksMax)
+		if err != nil {
+			return "", "", err
+		}
+		return DockerDaemonConfig(), unit, nil
+	case ContainerRuntimeContainerd:
+		config, err := ContainerdConfig(sandboxImage)
+		if err != nil {
+			return "", "", err
+		}
+		unit, err := ContainerdSystemdUnit()
+		if err != nil {
+			return "", "", err
+		}
+		return config, unit, nil
+	case ContainerRuntimeCRIO:
+		config, err := CRIOConfig(sandboxImage)
+		if err != nil {
+			return "", "", err
+		}
+		unit, err := CRIOSystemdUnit()
+		if err != nil {
+			return "", "", err
+		}
+		return config, unit, nil
+	}
+
+	return "", "", fmt.Errorf("unknown container runtime %q", cr)
+}
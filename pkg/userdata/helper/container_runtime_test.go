@@ -0,0 +1,108 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContainerdConfig(t *testing.T) {
+	config, err := ContainerdConfig("registry.k8s.io/pause:3.9")
+	if err != nil {
+		t.Fatalf("ContainerdConfig returned an error: %v", err)
+	}
+	if !strings.Contains(config, `sandbox_image = "registry.k8s.io/pause:3.9"`) {
+		t.Errorf("expected config to contain the sandbox image, got:\n%s", config)
+	}
+	if !strings.Contains(config, "SystemdCgroup = true") {
+		t.Errorf("expected config to enable the systemd cgroup driver, got:\n%s", config)
+	}
+}
+
+func TestContainerdSystemdUnit(t *testing.T) {
+	unit, err := ContainerdSystemdUnit()
+	if err != nil {
+		t.Fatalf("ContainerdSystemdUnit returned an error: %v", err)
+	}
+	for _, want := range []string{"Delegate=yes", "KillMode=process", "LimitNOFILE=infinity"} {
+		if !strings.Contains(unit, want) {
+			t.Errorf("expected unit to contain %q, got:\n%s", want, unit)
+		}
+	}
+}
+
+func TestCRIOConfig(t *testing.T) {
+	config, err := CRIOConfig("registry.k8s.io/pause:3.9")
+	if err != nil {
+		t.Fatalf("CRIOConfig returned an error: %v", err)
+	}
+	if !strings.Contains(config, `pause_image = "registry.k8s.io/pause:3.9"`) {
+		t.Errorf("expected config to contain the sandbox image, got:\n%s", config)
+	}
+	if !strings.Contains(config, `cgroup_manager = "systemd"`) {
+		t.Errorf("expected config to use the systemd cgroup manager, got:\n%s", config)
+	}
+}
+
+func TestCRIOSystemdUnit(t *testing.T) {
+	unit, err := CRIOSystemdUnit()
+	if err != nil {
+		t.Fatalf("CRIOSystemdUnit returned an error: %v", err)
+	}
+	if !strings.Contains(unit, "ExecStart=/opt/bin/crio") {
+		t.Errorf("expected unit to start crio, got:\n%s", unit)
+	}
+}
+
+func TestKubeletContainerRuntimeFlags(t *testing.T) {
+	tests := []struct {
+		cr      ContainerRuntime
+		wantErr bool
+		want    []string
+	}{
+		{cr: ContainerRuntimeDocker, want: nil},
+		{cr: "", want: nil},
+		{cr: ContainerRuntimeContainerd, want: []string{
+			"--container-runtime=remote",
+			"--container-runtime-endpoint=unix:///run/containerd/containerd.sock",
+		}},
+		{cr: ContainerRuntimeCRIO, want: []string{
+			"--container-runtime=remote",
+			"--container-runtime-endpoint=unix:///var/run/crio/crio.sock",
+		}},
+		{cr: "bogus", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := KubeletContainerRuntimeFlags(test.cr)
+		if (err != nil) != test.wantErr {
+			t.Errorf("KubeletContainerRuntimeFlags(%q) error = %v, wantErr %v", test.cr, err, test.wantErr)
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("KubeletContainerRuntimeFlags(%q) = %v, want %v", test.cr, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("KubeletContainerRuntimeFlags(%q) = %v, want %v", test.cr, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestContainerRuntimeConfigAndUnit(t *testing.T) {
+	for _, cr := range []ContainerRuntime{ContainerRuntimeDocker, ContainerRuntimeContainerd, ContainerRuntimeCRIO} {
+		config, unit, err := ContainerRuntimeConfigAndUnit(cr, true, "registry.k8s.io/pause:3.9")
+		if err != nil {
+			t.Fatalf("ContainerRuntimeConfigAndUnit(%q) returned an error: %v", cr, err)
+		}
+		if config == "" || unit == "" {
+			t.Errorf("ContainerRuntimeConfigAndUnit(%q) returned an empty config or unit", cr)
+		}
+	}
+
+	if _, _, err := ContainerRuntimeConfigAndUnit("bogus", true, ""); err == nil {
+		t.Error("expected an error for an unknown container runtime, got nil")
+	}
+}